@@ -0,0 +1,370 @@
+// Package filecache provides a small filesystem-based cache with TTL
+// semantics, plus a named-cache registry so the rest of the app can pull
+// pre-configured instances from a single source of truth instead of
+// constructing them ad-hoc.
+package filecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// NeverExpire, used as a FileCache TTL, means entries are never considered
+// stale by time alone.
+const NeverExpire time.Duration = -1
+
+// Status reports where the bytes returned by GetOrCreate came from.
+type Status int
+
+const (
+	// Miss means the generator ran: there was no usable cached entry.
+	Miss Status = iota
+	// Hit means a fresh cached entry was returned without calling the generator.
+	Hit
+	// Stale means a cached entry past its TTL, but still within StaleGrace,
+	// was returned immediately while a background refresh was kicked off
+	// (or was already in flight).
+	Stale
+)
+
+func (s Status) String() string {
+	switch s {
+	case Hit:
+		return "HIT"
+	case Stale:
+		return "STALE"
+	default:
+		return "MISS"
+	}
+}
+
+// FileCache is a filesystem based cache with TTL semantics. It is
+// intentionally tiny and dependency-free.
+//
+// A FileCache whose TTL is 0 is "disabled": GetOrCreate becomes a pure
+// pass-through that always calls the generator and never touches disk.
+type FileCache struct {
+	Dir        string        // Directory root where cache files are stored
+	TTL        time.Duration // Time to live for each cached artifact; NeverExpire or 0 are special, see above
+	StaleGrace time.Duration // How long past TTL a stale entry may still be served while refreshing in the background
+
+	mu        sync.RWMutex           // (reserved for future dir-wide ops)
+	perKeyMu  map[string]*sync.Mutex // per-key mutexes avoid duplicate generation
+	perKeyMuG sync.Mutex             // guards perKeyMu map
+}
+
+// New constructs a new cache. The directory is created if missing, unless
+// the cache is disabled (ttl == 0), in which case dir is never touched.
+func New(dir string, ttl time.Duration) (*FileCache, error) {
+	if ttl < NeverExpire {
+		return nil, fmt.Errorf("ttl must be >= %s", NeverExpire)
+	}
+	if ttl == 0 {
+		return &FileCache{Dir: dir, TTL: 0, perKeyMu: make(map[string]*sync.Mutex)}, nil
+	}
+	if dir == "" {
+		return nil, errors.New("cache directory cannot be empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating cache dir: %w", err)
+	}
+	return &FileCache{
+		Dir:      dir,
+		TTL:      ttl,
+		perKeyMu: make(map[string]*sync.Mutex),
+	}, nil
+}
+
+// WithStaleGrace sets the receiver's StaleGrace and returns it, for
+// convenient chaining off New.
+func (c *FileCache) WithStaleGrace(d time.Duration) *FileCache {
+	c.StaleGrace = d
+	return c
+}
+
+// Disabled reports whether this cache is a no-op pass-through.
+func (c *FileCache) Disabled() bool {
+	return c.TTL == 0
+}
+
+// keyName hashes key into the filename stem shared by a cache entry and its ETag sidecar.
+func (c *FileCache) keyName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16]) // first 16 bytes (128 bits) is enough
+}
+
+// filePath returns an absolute path for a given cache key.
+func (c *FileCache) filePath(key string) string {
+	return filepath.Join(c.Dir, c.keyName(key)+".bin")
+}
+
+// etagPath returns the path of the ETag sidecar file for a given cache key.
+func (c *FileCache) etagPath(key string) string {
+	return filepath.Join(c.Dir, c.keyName(key)+".etag")
+}
+
+// getPerKeyMutex returns a mutex pointer for the provided key.
+func (c *FileCache) getPerKeyMutex(key string) *sync.Mutex {
+	c.perKeyMuG.Lock()
+	defer c.perKeyMuG.Unlock()
+	m, ok := c.perKeyMu[key]
+	if !ok {
+		m = &sync.Mutex{}
+		c.perKeyMu[key] = m
+	}
+	return m
+}
+
+// expired reports whether modTime is stale given the cache TTL.
+func (c *FileCache) expired(modTime time.Time) bool {
+	if c.TTL == NeverExpire {
+		return false
+	}
+	return time.Since(modTime) > c.TTL
+}
+
+// Peek reads the cache entry for key regardless of TTL freshness, along
+// with the file's modification time. It is used by callers that need to
+// revalidate a stale-but-present entry themselves (e.g. a conditional
+// HTTP request) instead of treating expiry as a plain cache miss.
+func (c *FileCache) Peek(key string) (data []byte, modTime time.Time, ok bool, err error) {
+	if c.Disabled() {
+		return nil, time.Time{}, false, nil
+	}
+	path := c.filePath(key)
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, time.Time{}, false, nil
+		}
+		return nil, time.Time{}, false, fmt.Errorf("stat cache file: %w", err)
+	}
+	if fi.Size() == 0 {
+		return nil, time.Time{}, false, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("read cache file: %w", err)
+	}
+	return b, fi.ModTime(), true, nil
+}
+
+// Get attempts to read a valid (non-expired) cache entry for key.
+// Returns (data, true, nil) on a cache hit.
+// Returns (_, false, nil) if the item is missing, expired, or the cache is disabled.
+func (c *FileCache) Get(key string) ([]byte, bool, error) {
+	if c.Disabled() {
+		return nil, false, nil
+	}
+	path := c.filePath(key)
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("stat cache file: %w", err)
+	}
+	if fi.Size() == 0 {
+		// Treat zero length as invalid (possibly interrupted write)
+		return nil, false, nil
+	}
+	if c.expired(fi.ModTime()) {
+		return nil, false, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("open cache file: %w", err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, false, fmt.Errorf("read cache file: %w", err)
+	}
+	return b, true, nil
+}
+
+// ETag returns the strong ETag (SHA-256 of the cached bytes, quoted per RFC
+// 9110) recorded alongside key's cache entry, if any.
+func (c *FileCache) ETag(key string) (string, bool, error) {
+	b, err := os.ReadFile(c.etagPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("read etag file: %w", err)
+	}
+	return string(b), true, nil
+}
+
+// GetOrCreate returns cached data for key if present and fresh; otherwise
+// it calls generator, stores the result, and returns it. Status reports
+// whether the bytes are a fresh Hit, a Stale-while-revalidate entry, or the
+// result of a fresh Miss generation.
+//
+// If the cache is disabled (TTL == 0), GetOrCreate is a pass-through: it
+// always calls generator and never reads or writes disk.
+func (c *FileCache) GetOrCreate(key string, generator func() ([]byte, error)) ([]byte, Status, error) {
+	if c.Disabled() {
+		data, err := generator()
+		return data, Miss, err
+	}
+
+	// Fast path: attempt read without locking generation path
+	if data, ok, err := c.Get(key); err != nil {
+		return nil, Miss, err
+	} else if ok {
+		return data, Hit, nil
+	}
+
+	if stale, status, ok, err := c.tryServeStale(key, generator); err != nil {
+		return nil, Miss, err
+	} else if ok {
+		return stale, status, nil
+	}
+
+	m := c.getPerKeyMutex(key)
+	m.Lock()
+	defer m.Unlock()
+
+	// Re-check after acquiring lock to avoid duplicate generation
+	if data, ok, err := c.Get(key); err != nil {
+		return nil, Miss, err
+	} else if ok {
+		return data, Hit, nil
+	}
+
+	data, err := generator()
+	if err != nil {
+		return nil, Miss, err
+	}
+
+	if err := c.writeFileAtomically(key, data); err != nil {
+		return nil, Miss, err
+	}
+	return data, Miss, nil
+}
+
+// tryServeStale returns (data, Stale, true, nil) when key has an entry that
+// is past its TTL but still within StaleGrace, kicking off a single
+// background regeneration as a side effect. ok is false when SWR doesn't
+// apply (no StaleGrace configured, no entry, or entry too old even for
+// StaleGrace), in which case the caller should fall through to a normal
+// blocking generation.
+func (c *FileCache) tryServeStale(key string, generator func() ([]byte, error)) (data []byte, status Status, ok bool, err error) {
+	if c.StaleGrace <= 0 || c.TTL == NeverExpire {
+		return nil, Miss, false, nil
+	}
+	data, modTime, found, err := c.Peek(key)
+	if err != nil || !found {
+		return nil, Miss, false, err
+	}
+	if time.Since(modTime) > c.TTL+c.StaleGrace {
+		return nil, Miss, false, nil
+	}
+	c.refreshInBackground(key, generator)
+	return data, Stale, true, nil
+}
+
+// refreshInBackground regenerates key's entry in a goroutine, guarded by the
+// per-key mutex's TryLock so at most one refresh for a given key is ever in
+// flight; callers racing a refresh already underway simply skip theirs.
+func (c *FileCache) refreshInBackground(key string, generator func() ([]byte, error)) {
+	m := c.getPerKeyMutex(key)
+	if !m.TryLock() {
+		return
+	}
+	go func() {
+		defer m.Unlock()
+		data, err := generator()
+		if err != nil {
+			return
+		}
+		_ = c.writeFileAtomically(key, data)
+	}()
+}
+
+// writeFileAtomically writes bytes to the final cache path using a temp file
+// + rename, and records a strong ETag sidecar alongside it.
+func (c *FileCache) writeFileAtomically(key string, data []byte) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return fmt.Errorf("ensure cache dir: %w", err)
+	}
+	if err := c.writeAtomically(c.filePath(key), data); err != nil {
+		return fmt.Errorf("write cache file: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if err := c.writeAtomically(c.etagPath(key), []byte(etag)); err != nil {
+		return fmt.Errorf("write etag file: %w", err)
+	}
+	return nil
+}
+
+// writeAtomically writes data to finalPath via a temp file + rename so
+// concurrent readers never observe a partially written file.
+func (c *FileCache) writeAtomically(finalPath string, data []byte) error {
+	tmp, err := os.CreateTemp(c.Dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	// Ensure cleanup on failure
+	defer func() {
+		tmp.Close()
+		_ = os.Remove(tmpPath)
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpired scans the cache directory and deletes any expired entries,
+// i.e. those older than TTL plus StaleGrace, so entries that may still be
+// served stale are kept. It is optional; the cache still works without
+// calling it. Best effort only.
+func (c *FileCache) PurgeExpired() error {
+	if c.Disabled() || c.TTL == NeverExpire {
+		return nil
+	}
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read cache dir: %w", err)
+	}
+	deadline := time.Now().Add(-(c.TTL + c.StaleGrace))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(deadline) {
+			_ = os.Remove(filepath.Join(c.Dir, e.Name()))
+		}
+	}
+	return nil
+}
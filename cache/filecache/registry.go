@@ -0,0 +1,188 @@
+package filecache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Caches is a named-cache registry. The HTTP handler, the image
+// downloader, and any future Directus-API client all pull their
+// pre-configured *FileCache instances from here rather than constructing
+// one ad-hoc.
+type Caches struct {
+	named map[string]*FileCache
+}
+
+// Get returns the named cache, or nil if no cache was configured under that name.
+func (c *Caches) Get(name string) *FileCache {
+	return c.named[name]
+}
+
+// entryConfig is the on-disk/env shape for a single named cache.
+type entryConfig struct {
+	Dir        string `json:"dir"`
+	MaxAge     string `json:"maxAge"`
+	StaleGrace string `json:"staleGrace"`
+}
+
+// fileConfig is the shape of the JSON config file.
+type fileConfig struct {
+	Caches map[string]entryConfig `json:"caches"`
+}
+
+// defaultConfig is used when no config file is present and no overriding
+// environment variables are set. composite gets a StaleGrace so the
+// "first request after 24h" regeneration doesn't block on a pile of image
+// downloads; the other caches don't need stale-while-revalidate.
+var defaultConfig = map[string]entryConfig{
+	"composite":    {Dir: ":cacheDir/composite", MaxAge: "24h", StaleGrace: "1h"},
+	"sourceimages": {Dir: ":cacheDir/sourceimages", MaxAge: "168h"},
+	"directus":     {Dir: ":cacheDir/directus", MaxAge: "5m"},
+}
+
+// Load builds a Caches registry from a JSON config file (if configPath
+// exists) layered with CACHE_<NAME>_DIR / CACHE_<NAME>_MAXAGE / CACHE_<NAME>_STALEGRACE
+// environment overrides, falling back to defaultConfig for any cache not
+// otherwise configured. Path placeholders (":cacheDir", ":resourceDir") are
+// resolved before each cache directory is created.
+func Load(configPath string) (*Caches, error) {
+	entries := make(map[string]entryConfig, len(defaultConfig))
+	for name, e := range defaultConfig {
+		entries[name] = e
+	}
+
+	if configPath != "" {
+		if b, err := os.ReadFile(configPath); err == nil {
+			var fc fileConfig
+			if err := json.Unmarshal(b, &fc); err != nil {
+				return nil, fmt.Errorf("parsing cache config %s: %w", configPath, err)
+			}
+			for name, e := range fc.Caches {
+				entries[name] = e
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("reading cache config %s: %w", configPath, err)
+		}
+	}
+
+	applyEnvOverrides(entries)
+
+	resourceDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("resolving :resourceDir: %w", err)
+	}
+	cacheDir := filepath.Join(os.TempDir(), "imreally_cache")
+
+	named := make(map[string]*FileCache, len(entries))
+	for name, e := range entries {
+		dir := resolvePlaceholders(e.Dir, cacheDir, resourceDir)
+		ttl, err := parseMaxAge(e.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("cache %q: %w", name, err)
+		}
+		fc, err := New(dir, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("cache %q: %w", name, err)
+		}
+		if e.StaleGrace != "" {
+			grace, err := parseStaleGrace(e.StaleGrace)
+			if err != nil {
+				return nil, fmt.Errorf("cache %q: invalid staleGrace %q: %w", name, e.StaleGrace, err)
+			}
+			fc.WithStaleGrace(grace)
+		}
+		named[name] = fc
+	}
+
+	c := &Caches{named: named}
+	c.startPurging()
+	return c, nil
+}
+
+// purgeInterval is how often each cache's background purge goroutine runs.
+const purgeInterval = 10 * time.Minute
+
+// startPurging launches one background goroutine per finite-TTL cache that
+// periodically removes expired entries from disk. Disabled caches and
+// never-expiring caches have nothing to purge.
+func (c *Caches) startPurging() {
+	for _, fc := range c.named {
+		if fc.Disabled() || fc.TTL == NeverExpire {
+			continue
+		}
+		fc := fc
+		go func() {
+			ticker := time.NewTicker(purgeInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				_ = fc.PurgeExpired()
+			}
+		}()
+	}
+}
+
+// applyEnvOverrides mutates entries in place from CACHE_<NAME>_DIR,
+// CACHE_<NAME>_MAXAGE, and CACHE_<NAME>_STALEGRACE, where <NAME> is the
+// upper-cased cache name.
+func applyEnvOverrides(entries map[string]entryConfig) {
+	for name, e := range entries {
+		envName := strings.ToUpper(name)
+		if dir := os.Getenv("CACHE_" + envName + "_DIR"); dir != "" {
+			e.Dir = dir
+		}
+		if maxAge := os.Getenv("CACHE_" + envName + "_MAXAGE"); maxAge != "" {
+			e.MaxAge = maxAge
+		}
+		if staleGrace := os.Getenv("CACHE_" + envName + "_STALEGRACE"); staleGrace != "" {
+			e.StaleGrace = staleGrace
+		}
+		entries[name] = e
+	}
+}
+
+// resolvePlaceholders replaces the ":cacheDir" and ":resourceDir" tokens in
+// dir with their resolved values.
+func resolvePlaceholders(dir, cacheDir, resourceDir string) string {
+	dir = strings.ReplaceAll(dir, ":cacheDir", cacheDir)
+	dir = strings.ReplaceAll(dir, ":resourceDir", resourceDir)
+	return dir
+}
+
+// parseMaxAge parses a maxAge string. "-1" means NeverExpire, "0" means
+// disabled, and anything else is parsed with time.ParseDuration (falling
+// back to plain integer seconds for convenience).
+func parseMaxAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "", "-1":
+		return NeverExpire, nil
+	case "0":
+		return 0, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return 0, fmt.Errorf("invalid maxAge %q", s)
+}
+
+// parseStaleGrace parses a staleGrace string with time.ParseDuration,
+// falling back to plain integer seconds like parseMaxAge (minus its "-1"/"0"
+// sentinels, which don't apply to a grace period).
+func parseStaleGrace(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return 0, fmt.Errorf("invalid staleGrace %q", s)
+}
@@ -5,6 +5,8 @@ import (
 	"math"
 )
 
+// GridDimensions describes a uniform grid arrangement: Cols x Rows tiles,
+// each PicWidth x PicHeight.
 type GridDimensions struct {
 	Cols      int
 	Rows      int
@@ -12,6 +14,37 @@ type GridDimensions struct {
 	PicHeight int
 }
 
+// FixedRatioLayout is the original brute-force search for the best uniform
+// grid of fixed 2:1 tiles. It ignores each image's own aspect ratio, so it
+// doesn't need a dimension-probing pass.
+type FixedRatioLayout struct{}
+
+func (FixedRatioLayout) Layout(canvasWidth, canvasHeight int, images []ImageDimensions) []Placement {
+	grid := calculateOptimalGrid(canvasWidth, canvasHeight, len(images))
+	return gridPlacements(grid, len(images))
+}
+
+// gridPlacements expands a uniform GridDimensions into one Placement per
+// image in row-major order, capped at the grid's Cols*Rows capacity.
+func gridPlacements(grid GridDimensions, count int) []Placement {
+	capacity := grid.Cols * grid.Rows
+	if count > capacity {
+		count = capacity
+	}
+	placements := make([]Placement, count)
+	for i := 0; i < count; i++ {
+		col := i % grid.Cols
+		row := i / grid.Cols
+		placements[i] = Placement{
+			X:      col * grid.PicWidth,
+			Y:      row * grid.PicHeight,
+			Width:  grid.PicWidth,
+			Height: grid.PicHeight,
+		}
+	}
+	return placements
+}
+
 // finds the best grid arrangement for the given parameters
 func calculateOptimalGrid(canvasWidth, canvasHeight, pictureCount int) GridDimensions {
 	var bestCols, bestRows int
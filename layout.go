@@ -0,0 +1,67 @@
+package main
+
+import "strings"
+
+// ImageDimensions is the natural size of a source image, as reported by a
+// cheap image.DecodeConfig pass rather than a full decode. Width/Height are
+// 0 when unknown.
+type ImageDimensions struct {
+	Width  int
+	Height int
+}
+
+// AspectRatio returns Width/Height, or 0 if Height is unknown/zero.
+func (d ImageDimensions) AspectRatio() float64 {
+	if d.Height == 0 {
+		return 0
+	}
+	return float64(d.Width) / float64(d.Height)
+}
+
+// Placement is where and at what size one picture should be pasted onto the
+// composite canvas.
+type Placement struct {
+	X, Y          int
+	Width, Height int
+}
+
+// LayoutStrategy arranges len(images) pictures within a canvasWidth x
+// canvasHeight canvas, returning one Placement per image in the same order.
+// A strategy with no room for every image may return fewer Placements,
+// covering only the first images (FixedRatioLayout returns none when no grid
+// fits). Strategies that don't need per-image aspect ratios (e.g. FixedRatioLayout)
+// may ignore the Width/Height of each images entry.
+type LayoutStrategy interface {
+	Layout(canvasWidth, canvasHeight int, images []ImageDimensions) []Placement
+}
+
+// needsImageDimensions reports whether a strategy needs real ImageDimensions
+// (as opposed to being indifferent to them, like FixedRatioLayout). Layout
+// strategies that pack by aspect ratio should implement this so callers can
+// skip the dimension-probing pass when it would be wasted work.
+type needsImageDimensions interface {
+	needsImageDimensions() bool
+}
+
+func strategyNeedsImageDimensions(s LayoutStrategy) bool {
+	n, ok := s.(needsImageDimensions)
+	return ok && n.needsImageDimensions()
+}
+
+const defaultLayoutStrategyName = "fixed"
+
+// layoutStrategies is the registry consulted by the ?layout= query param.
+var layoutStrategies = map[string]LayoutStrategy{
+	"fixed":   FixedRatioLayout{},
+	"mosaic":  MosaicLayout{},
+	"masonry": MasonryLayout{},
+}
+
+// negotiateLayout resolves the ?layout= query param to a registered
+// LayoutStrategy, falling back to defaultLayoutStrategyName.
+func negotiateLayout(name string) (string, LayoutStrategy) {
+	if s, ok := layoutStrategies[strings.ToLower(name)]; ok {
+		return strings.ToLower(name), s
+	}
+	return defaultLayoutStrategyName, layoutStrategies[defaultLayoutStrategyName]
+}
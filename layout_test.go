@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+func dimsOf(ratios ...float64) []ImageDimensions {
+	dims := make([]ImageDimensions, len(ratios))
+	for i, ar := range ratios {
+		// Encode the ratio as integer width/height so AspectRatio() round-trips.
+		const scale = 1000
+		dims[i] = ImageDimensions{Width: int(ar * scale), Height: scale}
+	}
+	return dims
+}
+
+func assertPlacementsSane(t *testing.T, strategyName string, placements []Placement, want int) {
+	t.Helper()
+	if len(placements) != want {
+		t.Fatalf("%s: got %d placements, want %d", strategyName, len(placements), want)
+	}
+	for i, p := range placements {
+		if p.Width <= 0 || p.Height <= 0 {
+			t.Errorf("%s: placement %d has non-positive size %+v", strategyName, i, p)
+		}
+	}
+}
+
+func TestLayoutStrategies_SingleImage(t *testing.T) {
+	for name, strategy := range layoutStrategies {
+		placements := strategy.Layout(1024, 2048, dimsOf(1.5))
+		assertPlacementsSane(t, name, placements, 1)
+	}
+}
+
+func TestLayoutStrategies_PrimeCount(t *testing.T) {
+	ratios := make([]float64, 13)
+	for i := range ratios {
+		ratios[i] = 1.5
+	}
+	for name, strategy := range layoutStrategies {
+		placements := strategy.Layout(1024, 2048, dimsOf(ratios...))
+		assertPlacementsSane(t, name, placements, 13)
+	}
+}
+
+func TestLayoutStrategies_ExtremeAspectRatios(t *testing.T) {
+	ratios := []float64{20, 0.05, 1, 10, 0.1}
+	for name, strategy := range layoutStrategies {
+		placements := strategy.Layout(1024, 2048, dimsOf(ratios...))
+		assertPlacementsSane(t, name, placements, len(ratios))
+	}
+}
+
+func TestLayoutStrategies_NoImages(t *testing.T) {
+	for name, strategy := range layoutStrategies {
+		placements := strategy.Layout(1024, 2048, nil)
+		if len(placements) != 0 {
+			t.Errorf("%s: expected no placements for no images, got %d", name, len(placements))
+		}
+	}
+}
+
+func TestMosaicLayout_RowsFillCanvasWidth(t *testing.T) {
+	placements := MosaicLayout{}.Layout(1024, 2048, dimsOf(1, 1, 1, 1, 1, 1))
+	rows := map[int][]Placement{}
+	for _, p := range placements {
+		rows[p.Y] = append(rows[p.Y], p)
+	}
+	for y, row := range rows {
+		total := 0
+		for _, p := range row {
+			total += p.Width
+		}
+		if total < 1024-len(row) || total > 1024+len(row) {
+			t.Errorf("row at y=%d has total width %d, want close to 1024", y, total)
+		}
+	}
+}
+
+func TestMasonryLayout_UsesMultipleColumnsWhenTheyFit(t *testing.T) {
+	// Wide canvas, enough square-ish images: should spread across more than one column.
+	placements := MasonryLayout{}.Layout(2048, 512, dimsOf(1, 1, 1, 1, 1, 1, 1, 1, 1))
+	cols := map[int]bool{}
+	for _, p := range placements {
+		cols[p.X] = true
+	}
+	if len(cols) < 2 {
+		t.Errorf("expected placements to span multiple columns, got X values %v", cols)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// defaultMaxConcurrentImageDownloads and defaultMaxConcurrentAPICalls are
+// used when the corresponding env var is unset or invalid.
+const (
+	defaultMaxConcurrentImageDownloads = 10
+	defaultMaxConcurrentAPICalls       = 4
+)
+
+// Limiter holds a set of named, buffered-channel semaphores. Each named
+// resource (e.g. outbound image downloads, Directus API calls) gets its own
+// concurrency budget, independent of whatever worker pool is driving it.
+type Limiter struct {
+	sems map[string]chan struct{}
+}
+
+// NewLimiterFromEnv builds the Limiter used by the rest of the app, sizing
+// its semaphores from MAX_CONCURRENT_IMAGE_DOWNLOADS and
+// MAX_CONCURRENT_API_CALLS.
+func NewLimiterFromEnv() *Limiter {
+	return &Limiter{
+		sems: map[string]chan struct{}{
+			"imageSem": make(chan struct{}, envInt("MAX_CONCURRENT_IMAGE_DOWNLOADS", defaultMaxConcurrentImageDownloads)),
+			"apiSem":   make(chan struct{}, envInt("MAX_CONCURRENT_API_CALLS", defaultMaxConcurrentAPICalls)),
+		},
+	}
+}
+
+// WithContext acquires a slot on the named semaphore, blocking until one is
+// free or ctx is done. On success it returns a release func that must be
+// called to free the slot; on cancellation it returns ctx.Err() instead of
+// blocking forever. Note that ctx cancellation here only covers things like
+// server shutdown, not a client disconnecting mid-request - callers should
+// not assume a dropped browser connection frees a waiting slot early; see
+// the caller in wallHandler for why.
+func (l *Limiter) WithContext(ctx context.Context, name string) (release func(), err error) {
+	sem, ok := l.sems[name]
+	if !ok {
+		return nil, fmt.Errorf("limiter: unknown semaphore %q", name)
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// envInt reads name from the environment, falling back to def if unset or
+// not a valid positive integer.
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
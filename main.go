@@ -2,15 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"image"
-	"image/jpeg"
 	"log"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/artifishvr/img.imreally.gay/cache/filecache"
 	"github.com/go-resty/resty/v2"
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/logger"
@@ -29,6 +31,16 @@ type APIResponse struct {
 	} `json:"data"`
 }
 
+// Dependencies bundles the shared, long-lived collaborators the HTTP
+// handlers need, so routes pull them from a single source of truth instead
+// of closing over a pile of loose globals.
+type Dependencies struct {
+	Client        *resty.Client
+	DirectusToken string
+	Caches        *filecache.Caches
+	Limiter       *Limiter
+}
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -37,29 +49,54 @@ func main() {
 
 	app := fiber.New()
 	app.Use(logger.New())
-	client := resty.New()
-
-	directusToken := os.Getenv("DIRECTUS_TOKEN")
 
-	// Initialize a 24h filesystem cache for the composite image
-	cache, err := NewFileCache("cache", 24*time.Hour)
+	// Load the named-cache registry (composite/sourceimages/directus/...) from
+	// CACHE_CONFIG_FILE, falling back to built-in defaults for anything unset.
+	caches, err := filecache.Load(os.Getenv("CACHE_CONFIG_FILE"))
 	if err != nil {
-		log.Fatalf("failed to init cache: %v", err)
+		log.Fatalf("failed to init caches: %v", err)
+	}
+
+	deps := &Dependencies{
+		Client:        resty.New(),
+		DirectusToken: os.Getenv("DIRECTUS_TOKEN"),
+		Caches:        caches,
+		Limiter:       NewLimiterFromEnv(),
 	}
 
 	// Define a route for the GET method on the root path '/'
-	app.Get("/", func(c fiber.Ctx) error {
-		data, fromCache, err := cache.GetOrCreate("wall", func() ([]byte, error) {
-			var apiResponse APIResponse
-			resp, err := client.R().
-				SetHeader("Authorization", "Bearer "+directusToken).
-				SetResult(&apiResponse).
-				Get("https://api.imreally.gay/items/thewall")
+	app.Get("/", wallHandler(deps))
+
+	// Start the server on port 3000
+	log.Fatal(app.Listen(":3000"))
+}
+
+// wallHandler builds the composite wall image, reusing a cached copy when
+// possible and bounding outbound Directus/image requests through deps.Limiter.
+func wallHandler(deps *Dependencies) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		// c.RequestCtx() implements context.Context directly, tied to the
+		// fasthttp server's lifetime. fasthttp has no per-connection
+		// cancellation signal (RequestCtx.Done() only fires on server
+		// shutdown, see valyala/fasthttp#965), so a disconnecting browser
+		// does NOT free a waiting Limiter slot early - it still holds it
+		// until the in-flight download/API call finishes normally.
+		ctx := c.RequestCtx()
+		cache := deps.Caches.Get("composite")
+		sourceCache := deps.Caches.Get("sourceimages")
+
+		format, encoder := negotiateFormat(c.Query("format"), c.Get("Accept"))
+		quality := parseQuality(c.Query("q"))
+		outWidth := parseDimension(c.Query("w"))
+		outHeight := parseDimension(c.Query("h"))
+		layoutName, layout := negotiateLayout(c.Query("layout"))
+
+		cacheKey := fmt.Sprintf("wall:%s:%s:q%d:%dx%d", layoutName, format, quality, outWidth, outHeight)
+
+		data, status, err := cache.GetOrCreate(cacheKey, func() ([]byte, error) {
+			apiResponse, err := fetchThewall(ctx, deps)
 			if err != nil {
-				return nil, fmt.Errorf("api request: %w", err)
-			}
-			if resp.StatusCode() != 200 {
-				return nil, fmt.Errorf("api status %d", resp.StatusCode())
+				return nil, err
 			}
 
 			var pictureUUIDs []string
@@ -72,29 +109,33 @@ func main() {
 
 			height := 2048
 			width := 1024
-			picturecount := len(pictureUUIDs)
-			grid := calculateOptimalGrid(width, height, picturecount)
+			maxWorkers := 10
+
+			var dims []ImageDimensions
+			if strategyNeedsImageDimensions(layout) {
+				dims = probeImageDimensionsWithWorkerPool(ctx, pictureUUIDs, maxWorkers, sourceCache, deps.Limiter)
+			} else {
+				dims = make([]ImageDimensions, len(pictureUUIDs))
+			}
+			placements := layout.Layout(width, height, dims)
 
 			combined := imaging.New(width, height, image.Black)
 
-			maxWorkers := 10
-			images := downloadImagesWithWorkerPool(pictureUUIDs, grid, maxWorkers)
+			images := downloadImagesWithWorkerPool(ctx, pictureUUIDs, placements, maxWorkers, sourceCache, deps.Limiter)
 
-			for i := 0; i < grid.Cols*grid.Rows; i++ {
+			for i, placement := range placements {
 				img, exists := images[i]
 				if !exists {
 					continue
 				}
-				col := i % grid.Cols
-				row := i / grid.Cols
-				x := col * grid.PicWidth
-				y := row * grid.PicHeight
-				combined = imaging.Paste(combined, img, image.Pt(x, y))
+				combined = imaging.Paste(combined, img, image.Pt(placement.X, placement.Y))
 			}
 
+			output := resizeIfRequested(combined, outWidth, outHeight)
+
 			var buf bytes.Buffer
-			if err := jpeg.Encode(&buf, combined, &jpeg.Options{Quality: 90}); err != nil {
-				return nil, fmt.Errorf("encode jpeg: %w", err)
+			if err := encoder.Encode(&buf, output, quality); err != nil {
+				return nil, fmt.Errorf("encode %s: %w", format, err)
 			}
 			return buf.Bytes(), nil
 		})
@@ -106,18 +147,87 @@ func main() {
 			return c.Status(500).SendString("Failed to generate image")
 		}
 
-		c.Set("Content-Type", "image/jpeg")
-		c.Set("Content-Length", fmt.Sprintf("%d", len(data)))
-		if fromCache {
-			c.Set("X-Cache", "HIT")
-		} else {
-			c.Set("X-Cache", "MISS")
+		c.Set("Vary", "Accept")
+		c.Set("X-Cache", status.String())
+		setCacheControlHeaders(c, cache, cacheKey)
+
+		if etag, ok, err := cache.ETag(cacheKey); err == nil && ok {
+			c.Set("ETag", etag)
+			if match := c.Get("If-None-Match"); match != "" && match == etag {
+				return c.SendStatus(http.StatusNotModified)
+			}
 		}
+
+		c.Set("Content-Type", encoder.ContentType())
+		c.Set("Content-Length", fmt.Sprintf("%d", len(data)))
 		return c.Send(data)
+	}
+}
+
+// fetchThewall fetches the Directus "thewall" item list, reusing a cached
+// copy through the "directus" named cache so a burst of composite-cache
+// misses doesn't each hit the API, and bounding the outbound call through
+// deps.Limiter like any other Directus/image request.
+func fetchThewall(ctx context.Context, deps *Dependencies) (APIResponse, error) {
+	var apiResponse APIResponse
+
+	directusCache := deps.Caches.Get("directus")
+	body, _, err := directusCache.GetOrCreate("thewall", func() ([]byte, error) {
+		release, err := deps.Limiter.WithContext(ctx, "apiSem")
+		if err != nil {
+			return nil, fmt.Errorf("acquiring api semaphore: %w", err)
+		}
+		defer release()
+
+		resp, err := deps.Client.R().
+			SetContext(ctx).
+			SetHeader("Authorization", "Bearer "+deps.DirectusToken).
+			Get("https://api.imreally.gay/items/thewall")
+		if err != nil {
+			return nil, fmt.Errorf("api request: %w", err)
+		}
+		if resp.StatusCode() != 200 {
+			return nil, fmt.Errorf("api status %d", resp.StatusCode())
+		}
+		return resp.Body(), nil
 	})
+	if err != nil {
+		return apiResponse, err
+	}
 
-	// Start the server on port 3000
-	log.Fatal(app.Listen(":3000"))
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return apiResponse, fmt.Errorf("parsing api response: %w", err)
+	}
+	return apiResponse, nil
+}
+
+// setCacheControlHeaders emits Cache-Control for key based on cache's TTL and
+// StaleGrace, so CDNs/browsers can cooperate with the stale-while-revalidate
+// behavior implemented in FileCache.GetOrCreate.
+func setCacheControlHeaders(c fiber.Ctx, cache *filecache.FileCache, key string) {
+	if cache.TTL == filecache.NeverExpire {
+		c.Set("Cache-Control", "public, max-age=31536000, immutable")
+		return
+	}
+	if cache.Disabled() {
+		c.Set("Cache-Control", "no-store")
+		return
+	}
+
+	remaining := cache.TTL
+	if _, modTime, ok, err := cache.Peek(key); err == nil && ok {
+		if left := cache.TTL - time.Since(modTime); left > 0 {
+			remaining = left
+		} else {
+			remaining = 0
+		}
+	}
+
+	directive := fmt.Sprintf("public, max-age=%d", int(remaining.Seconds()))
+	if cache.StaleGrace > 0 {
+		directive += fmt.Sprintf(", stale-while-revalidate=%d", int(cache.StaleGrace.Seconds()))
+	}
+	c.Set("Cache-Control", directive)
 }
 
 func openRemoteImage(url string) (image.Image, error) {
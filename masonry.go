@@ -0,0 +1,63 @@
+package main
+
+import "math"
+
+// MasonryLayout splits the canvas into equal-width columns and assigns each
+// image, in order, to whichever column is currently shortest, preserving
+// that image's own aspect ratio.
+type MasonryLayout struct{}
+
+func (MasonryLayout) needsImageDimensions() bool { return true }
+
+func (MasonryLayout) Layout(canvasWidth, canvasHeight int, images []ImageDimensions) []Placement {
+	if len(images) == 0 {
+		return nil
+	}
+
+	numCols := masonryColumnCount(canvasWidth, canvasHeight, len(images))
+	colWidth := canvasWidth / numCols
+	if colWidth <= 0 {
+		colWidth = canvasWidth
+	}
+
+	colHeights := make([]int, numCols)
+	placements := make([]Placement, len(images))
+
+	for i, img := range images {
+		height := int(float64(colWidth) / safeAspectRatio(img))
+		if height <= 0 {
+			height = 1
+		}
+
+		col := shortestColumn(colHeights)
+		placements[i] = Placement{X: col * colWidth, Y: colHeights[col], Width: colWidth, Height: height}
+		colHeights[col] += height
+	}
+
+	return placements
+}
+
+// masonryColumnCount picks a column count that keeps columns roughly
+// square-tiled across the canvas, clamped to [1, count].
+func masonryColumnCount(canvasWidth, canvasHeight, count int) int {
+	cols := int(math.Round(math.Sqrt(float64(count) * float64(canvasWidth) / float64(canvasHeight))))
+	if cols < 1 {
+		cols = 1
+	}
+	if cols > count {
+		cols = count
+	}
+	return cols
+}
+
+// shortestColumn returns the index of the shortest column, the first one in
+// case of a tie.
+func shortestColumn(colHeights []int) int {
+	shortest := 0
+	for c := 1; c < len(colHeights); c++ {
+		if colHeights[c] < colHeights[shortest] {
+			shortest = c
+		}
+	}
+	return shortest
+}
@@ -0,0 +1,90 @@
+package main
+
+import "math"
+
+// MosaicLayout packs images into justified rows sized from each image's own
+// aspect ratio (a shelf-packing scheme): images are added to the current
+// row until its width, scaled to a target row height, would reach the
+// canvas width; the row is then closed and re-scaled so it exactly fills
+// canvasWidth, and the next row starts below it.
+type MosaicLayout struct{}
+
+func (MosaicLayout) needsImageDimensions() bool { return true }
+
+func (MosaicLayout) Layout(canvasWidth, canvasHeight int, images []ImageDimensions) []Placement {
+	if len(images) == 0 {
+		return nil
+	}
+
+	targetRowHeight := estimateTargetRowHeight(canvasHeight, len(images))
+
+	var rows [][]int
+	var row []int
+	rowAspectSum := 0.0
+	for i, img := range images {
+		row = append(row, i)
+		rowAspectSum += safeAspectRatio(img)
+		if rowAspectSum*float64(targetRowHeight) >= float64(canvasWidth) {
+			rows = append(rows, row)
+			row = nil
+			rowAspectSum = 0
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	placements := make([]Placement, len(images))
+	y := 0
+	for _, rowIdxs := range rows {
+		rowAspectSum := 0.0
+		for _, idx := range rowIdxs {
+			rowAspectSum += safeAspectRatio(images[idx])
+		}
+
+		rowHeight := int(float64(canvasWidth) / rowAspectSum)
+		if rowHeight <= 0 {
+			rowHeight = 1
+		}
+
+		x := 0
+		for _, idx := range rowIdxs {
+			width := int(safeAspectRatio(images[idx]) * float64(rowHeight))
+			if width <= 0 {
+				width = 1
+			}
+			placements[idx] = Placement{X: x, Y: y, Width: width, Height: rowHeight}
+			x += width
+		}
+		y += rowHeight
+	}
+
+	return placements
+}
+
+// safeAspectRatio returns d's aspect ratio, defaulting to 1 (square) when
+// unknown so a single bad probe can't divide-by-zero or collapse a row.
+func safeAspectRatio(d ImageDimensions) float64 {
+	if ar := d.AspectRatio(); ar > 0 {
+		return ar
+	}
+	return 1
+}
+
+// estimateTargetRowHeight picks a starting row height for the shelf-packing
+// pass: canvasHeight split across roughly sqrt(count) rows, so the mosaic
+// has a vaguely square cadence before rows get re-scaled to fit exactly.
+func estimateTargetRowHeight(canvasHeight, count int) int {
+	rows := int(math.Sqrt(float64(count)))
+	if rows < 1 {
+		rows = 1
+	}
+	h := canvasHeight / rows
+	if h <= 0 {
+		h = canvasHeight
+	}
+	if h <= 0 {
+		h = 1
+	}
+	return h
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/artifishvr/img.imreally.gay/cache/filecache"
 	"github.com/kovidgoyal/imaging"
 )
 
@@ -24,14 +30,19 @@ type ImageResult struct {
 	Error error
 }
 
-func downloadImagesWithWorkerPool(pictureUUIDs []string, grid GridDimensions, maxWorkers int) map[int]image.Image {
-	jobs := make(chan ImageJob, len(pictureUUIDs))
-	results := make(chan ImageResult, len(pictureUUIDs))
+// downloadImagesWithWorkerPool downloads and resizes one picture per
+// placement, each to that placement's own Width x Height. placements and
+// pictureUUIDs are index-aligned and placements may be shorter than
+// pictureUUIDs (the layout strategy may not have room for every picture).
+func downloadImagesWithWorkerPool(ctx context.Context, pictureUUIDs []string, placements []Placement, maxWorkers int, sourceCache *filecache.FileCache, limiter *Limiter) map[int]image.Image {
+	count := len(placements)
+	jobs := make(chan ImageJob, count)
+	results := make(chan ImageResult, count)
 
 	for w := 0; w < maxWorkers; w++ {
 		go func() {
 			for job := range jobs {
-				img, err := openRemoteImageWithTimeout(job.URL, 30*time.Second)
+				img, err := fetchSourceImage(ctx, sourceCache, limiter, job.UUID, job.URL, 30*time.Second)
 				var resizedImg image.Image
 				if err == nil {
 					resizedImg = imaging.Fill(img, job.PicWidth, job.PicHeight, imaging.Center, imaging.Lanczos)
@@ -47,22 +58,19 @@ func downloadImagesWithWorkerPool(pictureUUIDs []string, grid GridDimensions, ma
 
 	go func() {
 		defer close(jobs)
-		for i, uuid := range pictureUUIDs {
-			if i >= grid.Cols*grid.Rows {
-				break
-			}
+		for i := 0; i < count; i++ {
 			jobs <- ImageJob{
 				Index:     i,
-				UUID:      uuid,
-				URL:       fmt.Sprintf("https://api.imreally.gay/assets/%s", uuid),
-				PicWidth:  grid.PicWidth,
-				PicHeight: grid.PicHeight,
+				UUID:      pictureUUIDs[i],
+				URL:       fmt.Sprintf("https://api.imreally.gay/assets/%s", pictureUUIDs[i]),
+				PicWidth:  placements[i].Width,
+				PicHeight: placements[i].Height,
 			}
 		}
 	}()
 
 	images := make(map[int]image.Image)
-	for i := 0; i < len(pictureUUIDs) && i < grid.Cols*grid.Rows; i++ {
+	for i := 0; i < count; i++ {
 		result := <-results
 		if result.Error != nil {
 			log.Printf("Warning: Failed to process image at index %d: %v", result.Index, result.Error)
@@ -74,25 +82,164 @@ func downloadImagesWithWorkerPool(pictureUUIDs []string, grid GridDimensions, ma
 	return images
 }
 
-func openRemoteImageWithTimeout(url string, timeout time.Duration) (image.Image, error) {
-	client := &http.Client{
-		Timeout: timeout,
+// probeImageDimensionsWithWorkerPool reads each picture's natural dimensions
+// via image.DecodeConfig, without decoding the full image, so aspect-ratio-
+// aware LayoutStrategys can plan placements before any picture is pasted.
+// It goes through sourceCache the same way fetchSourceImage does, so a
+// picture already probed here is served from cache (not re-downloaded) when
+// downloadImagesWithWorkerPool fetches it again for pasting. A probe failure
+// yields a zero ImageDimensions, which safeAspectRatio treats as square.
+func probeImageDimensionsWithWorkerPool(ctx context.Context, pictureUUIDs []string, maxWorkers int, sourceCache *filecache.FileCache, limiter *Limiter) []ImageDimensions {
+	type probeResult struct {
+		index int
+		dims  ImageDimensions
+	}
+
+	jobs := make(chan int, len(pictureUUIDs))
+	results := make(chan probeResult, len(pictureUUIDs))
+
+	for w := 0; w < maxWorkers; w++ {
+		go func() {
+			for i := range jobs {
+				url := fmt.Sprintf("https://api.imreally.gay/assets/%s", pictureUUIDs[i])
+				dims, err := probeImageDimensions(ctx, sourceCache, limiter, pictureUUIDs[i], url, 30*time.Second)
+				if err != nil {
+					log.Printf("Warning: Failed to probe dimensions for index %d: %v", i, err)
+				}
+				results <- probeResult{index: i, dims: dims}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range pictureUUIDs {
+			jobs <- i
+		}
+	}()
+
+	dims := make([]ImageDimensions, len(pictureUUIDs))
+	for range pictureUUIDs {
+		r := <-results
+		dims[r.index] = r.dims
+	}
+	return dims
+}
+
+// probeImageDimensions decodes just the image header out of uuid's cached (or
+// freshly downloaded and cached) source bytes, returning its natural pixel
+// dimensions without decoding the whole image.
+func probeImageDimensions(ctx context.Context, sourceCache *filecache.FileCache, limiter *Limiter, uuid, url string, timeout time.Duration) (ImageDimensions, error) {
+	data, _, err := sourceCache.GetOrCreate(uuid, func() ([]byte, error) {
+		return downloadSourceImageEnvelope(ctx, sourceCache, limiter, uuid, url, timeout)
+	})
+	if err != nil {
+		return ImageDimensions{}, err
 	}
 
-	resp, err := client.Get(url)
+	_, body, err := decodeSourceImageEnvelope(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download image: %w", err)
+		return ImageDimensions{}, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to download image: status code %d", resp.StatusCode)
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return ImageDimensions{}, fmt.Errorf("failed to decode image header: %w", err)
 	}
+	return ImageDimensions{Width: cfg.Width, Height: cfg.Height}, nil
+}
 
-	img, _, err := image.Decode(resp.Body)
+// fetchSourceImage returns the decoded source image for uuid, persisting the
+// raw downloaded bytes (plus content-type) in sourceCache so a later
+// regeneration of the wall can reuse them instead of re-downloading from
+// Directus.
+func fetchSourceImage(ctx context.Context, sourceCache *filecache.FileCache, limiter *Limiter, uuid, url string, timeout time.Duration) (image.Image, error) {
+	data, _, err := sourceCache.GetOrCreate(uuid, func() ([]byte, error) {
+		return downloadSourceImageEnvelope(ctx, sourceCache, limiter, uuid, url, timeout)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+		return nil, err
 	}
 
+	_, body, err := decodeSourceImageEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
 	return img, nil
 }
+
+// downloadSourceImageEnvelope fetches uuid's raw bytes from url, sending an
+// If-Modified-Since header when a stale-but-present cache entry already
+// exists so a 304 lets us skip re-downloading the body entirely.
+func downloadSourceImageEnvelope(ctx context.Context, sourceCache *filecache.FileCache, limiter *Limiter, uuid, url string, timeout time.Duration) ([]byte, error) {
+	release, err := limiter.WithContext(ctx, "imageSem")
+	if err != nil {
+		return nil, fmt.Errorf("acquiring image semaphore: %w", err)
+	}
+	defer release()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	stale, staleModTime, hasStale, err := sourceCache.Peek(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if hasStale {
+		req.Header.Set("If-Modified-Since", staleModTime.UTC().Format(http.TimeFormat))
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if !hasStale {
+			return nil, fmt.Errorf("received 304 with no cached entry for %s", uuid)
+		}
+		return stale, nil
+	case http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image body: %w", err)
+		}
+		return encodeSourceImageEnvelope(resp.Header.Get("Content-Type"), body), nil
+	default:
+		return nil, fmt.Errorf("failed to download image: status code %d", resp.StatusCode)
+	}
+}
+
+// sourceImageEnvelopeSeparator delimits the small header from the raw image
+// bytes within a cached source-image entry.
+const sourceImageEnvelopeSeparator = "\n\n"
+
+// encodeSourceImageEnvelope prefixes body with a tiny header carrying the
+// content-type, so it can be recovered on a cache hit without a sidecar file.
+func encodeSourceImageEnvelope(contentType string, body []byte) []byte {
+	header := "Content-Type: " + contentType + sourceImageEnvelopeSeparator
+	return append([]byte(header), body...)
+}
+
+func decodeSourceImageEnvelope(data []byte) (contentType string, body []byte, err error) {
+	idx := bytes.Index(data, []byte(sourceImageEnvelopeSeparator))
+	if idx < 0 {
+		return "", nil, errors.New("malformed source image cache entry")
+	}
+	const prefix = "Content-Type: "
+	header := string(data[:idx])
+	if !strings.HasPrefix(header, prefix) {
+		return "", nil, errors.New("malformed source image cache entry header")
+	}
+	return strings.TrimPrefix(header, prefix), data[idx+len(sourceImageEnvelopeSeparator):], nil
+}